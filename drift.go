@@ -0,0 +1,180 @@
+package pop
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DriftKind identifies a specific way an applied or pending migration
+// set can have drifted from what Migrator expects.
+type DriftKind string
+
+const (
+	// DriftUnknownApplied means a version is recorded in the schema
+	// migrations table but has no corresponding file in
+	// Migrations["up"].
+	DriftUnknownApplied DriftKind = "unknown_applied"
+	// DriftOutOfOrder means a pending migration's version is lower
+	// than the highest already-applied version.
+	DriftOutOfOrder DriftKind = "out_of_order"
+	// DriftChecksumMismatch means a migration file's checksum differs
+	// from the migration_hash recorded when it was applied.
+	DriftChecksumMismatch DriftKind = "checksum_mismatch"
+)
+
+// Drift describes a single detected drift condition.
+type Drift struct {
+	Kind    DriftKind
+	Version string
+	Name    string
+	Detail  string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: version %s (%s): %s", d.Kind, d.Version, d.Name, d.Detail)
+}
+
+// DriftError is returned by Verify when one or more Drift conditions
+// are found. It lets callers (e.g. CI) gate on a clean migration
+// state.
+type DriftError struct {
+	Drifts []Drift
+}
+
+func (e *DriftError) Error() string {
+	lines := make([]string, len(e.Drifts))
+	for i, d := range e.Drifts {
+		lines[i] = d.String()
+	}
+	return fmt.Sprintf("migration drift detected:\n%s", strings.Join(lines, "\n"))
+}
+
+// appliedMigration is a single row read back from the schema
+// migrations table.
+type appliedMigration struct {
+	Version string `db:"version"`
+	Hash    string `db:"migration_hash"`
+}
+
+// Verify checks the database's applied migrations against
+// Migrations["up"] for three kinds of drift: an applied version with
+// no corresponding migration file, a pending migration that is
+// out-of-order relative to the highest applied version, and a
+// migration file whose checksum no longer matches what was recorded
+// when it was applied. It returns a *DriftError listing every drift
+// found, or nil if the migration state is clean.
+func (m Migrator) Verify() error {
+	return m.VerifyContext(context.Background())
+}
+
+// VerifyContext is Verify, with ctx threaded through the connection
+// calls it makes.
+func (m Migrator) VerifyContext(ctx context.Context) error {
+	if err := m.CreateSchemaMigrationsContext(ctx); err != nil {
+		return errors.Wrap(err, "problem creating schema migrations")
+	}
+
+	drifts, err := m.detectDriftContext(ctx)
+	if err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		return nil
+	}
+	return &DriftError{Drifts: drifts}
+}
+
+// detectDriftContext loads the database's applied migrations and
+// compares them against Migrations["up"], via computeDrift. It's
+// shared by Verify (which fails loudly on any drift) and Status (which
+// surfaces drift alongside the pending/applied table without failing).
+func (m Migrator) detectDriftContext(ctx context.Context) ([]Drift, error) {
+	c := m.Connection
+	mtn := m.migrationTableName()
+	var applied []appliedMigration
+	if err := c.RawQuery(fmt.Sprintf("select version, migration_hash from %s", mtn)).All(&applied); err != nil {
+		return nil, errors.Wrap(err, "problem loading applied migrations")
+	}
+
+	// Only compare against migrations that can actually apply under
+	// this connection's dialect. A migration tagged for a different
+	// dialect will never be applied here, so it must not be judged
+	// out-of-order just because its version sorts below the highest
+	// applied version.
+	var known Migrations
+	for _, mi := range m.Migrations["up"] {
+		if mi.DBType != "all" && mi.DBType != c.Dialect.Name() {
+			continue
+		}
+		known = append(known, mi)
+	}
+
+	return computeDrift(applied, known, m.IgnoreUnknown, m.AllowOutOfOrder), nil
+}
+
+// computeDrift is the pure comparison at the heart of Verify: given the
+// versions recorded as applied and the migrations known to exist, it
+// returns every detected Drift. It takes no database dependency so it
+// can be unit tested directly against hand-built fixtures.
+func computeDrift(applied []appliedMigration, known Migrations, ignoreUnknown, allowOutOfOrder bool) []Drift {
+	byVersion := map[string]Migration{}
+	for _, mi := range known {
+		byVersion[mi.Version] = mi
+	}
+
+	appliedByVersion := map[string]appliedMigration{}
+	var appliedVersions []string
+	for _, a := range applied {
+		appliedByVersion[a.Version] = a
+		appliedVersions = append(appliedVersions, a.Version)
+	}
+	sort.Strings(appliedVersions)
+
+	var drifts []Drift
+
+	for _, a := range applied {
+		mi, ok := byVersion[a.Version]
+		if !ok {
+			if ignoreUnknown {
+				continue
+			}
+			drifts = append(drifts, Drift{
+				Kind:    DriftUnknownApplied,
+				Version: a.Version,
+				Detail:  "recorded as applied, but no matching migration file was found",
+			})
+			continue
+		}
+		if a.Hash != "" && mi.Checksum != "" && a.Hash != mi.Checksum {
+			drifts = append(drifts, Drift{
+				Kind:    DriftChecksumMismatch,
+				Version: a.Version,
+				Name:    mi.Name,
+				Detail:  fmt.Sprintf("file checksum %s does not match recorded hash %s", mi.Checksum, a.Hash),
+			})
+		}
+	}
+
+	if !allowOutOfOrder && len(appliedVersions) > 0 {
+		highest := appliedVersions[len(appliedVersions)-1]
+		for _, mi := range known {
+			if _, ok := appliedByVersion[mi.Version]; ok {
+				continue
+			}
+			if mi.Version < highest {
+				drifts = append(drifts, Drift{
+					Kind:    DriftOutOfOrder,
+					Version: mi.Version,
+					Name:    mi.Name,
+					Detail:  fmt.Sprintf("pending, but lower than highest applied version %s", highest),
+				})
+			}
+		}
+	}
+
+	return drifts
+}
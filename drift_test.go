@@ -0,0 +1,71 @@
+package pop
+
+import "testing"
+
+func Test_computeDrift_clean(t *testing.T) {
+	applied := []appliedMigration{
+		{Version: "1", Hash: "abc"},
+		{Version: "2", Hash: "def"},
+	}
+	known := Migrations{
+		{Version: "1", Name: "one", Checksum: "abc"},
+		{Version: "2", Name: "two", Checksum: "def"},
+	}
+
+	drifts := computeDrift(applied, known, false, false)
+	if len(drifts) != 0 {
+		t.Fatalf("expected no drift, got %v", drifts)
+	}
+}
+
+func Test_computeDrift_unknownApplied(t *testing.T) {
+	applied := []appliedMigration{
+		{Version: "1", Hash: "abc"},
+		{Version: "2", Hash: "def"},
+	}
+	known := Migrations{
+		{Version: "1", Name: "one", Checksum: "abc"},
+	}
+
+	drifts := computeDrift(applied, known, false, false)
+	if len(drifts) != 1 || drifts[0].Kind != DriftUnknownApplied || drifts[0].Version != "2" {
+		t.Fatalf("expected a single unknown_applied drift for version 2, got %v", drifts)
+	}
+
+	if drifts := computeDrift(applied, known, true, false); len(drifts) != 0 {
+		t.Fatalf("expected IgnoreUnknown to suppress the drift, got %v", drifts)
+	}
+}
+
+func Test_computeDrift_outOfOrder(t *testing.T) {
+	applied := []appliedMigration{
+		{Version: "3", Hash: "ghi"},
+	}
+	known := Migrations{
+		{Version: "2", Name: "two", Checksum: "def"},
+		{Version: "3", Name: "three", Checksum: "ghi"},
+	}
+
+	drifts := computeDrift(applied, known, false, false)
+	if len(drifts) != 1 || drifts[0].Kind != DriftOutOfOrder || drifts[0].Version != "2" {
+		t.Fatalf("expected a single out_of_order drift for version 2, got %v", drifts)
+	}
+
+	if drifts := computeDrift(applied, known, false, true); len(drifts) != 0 {
+		t.Fatalf("expected AllowOutOfOrder to suppress the drift, got %v", drifts)
+	}
+}
+
+func Test_computeDrift_checksumMismatch(t *testing.T) {
+	applied := []appliedMigration{
+		{Version: "1", Hash: "abc"},
+	}
+	known := Migrations{
+		{Version: "1", Name: "one", Checksum: "changed"},
+	}
+
+	drifts := computeDrift(applied, known, false, false)
+	if len(drifts) != 1 || drifts[0].Kind != DriftChecksumMismatch || drifts[0].Version != "1" {
+		t.Fatalf("expected a single checksum_mismatch drift for version 1, got %v", drifts)
+	}
+}
@@ -0,0 +1,211 @@
+package pop
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc64"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Locker is implemented by anything that can serialize migration runs
+// across multiple processes (multiple app instances rolling out at
+// once, CI pipelines, k8s init containers) sharing the same database.
+type Locker interface {
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
+
+// NoLock is a Locker that performs no locking at all. Set
+// Migrator.Locker to NoLock to opt out of locking entirely, for
+// example when migrations are known to be run by a single process.
+var NoLock Locker = noLocker{}
+
+type noLocker struct{}
+
+func (noLocker) Lock(ctx context.Context) error   { return nil }
+func (noLocker) Unlock(ctx context.Context) error { return nil }
+
+// lockKey derives a stable identifier for the lock from the migration
+// table name, so that multiple applications sharing a single database
+// (but using different migration tables) don't contend on the same
+// lock.
+func lockKey(mtn string) int64 {
+	table := crc64.MakeTable(crc64.ECMA)
+	return int64(crc64.Checksum([]byte(mtn), table))
+}
+
+// pgLocker uses a session-scoped PostgreSQL advisory lock, keyed off a
+// crc64 hash of the migration table name. pg_advisory_lock and
+// pg_advisory_unlock are scoped to the session (connection) that
+// acquired them, so Lock and Unlock must run on the exact same
+// connection. A transaction opened via NewTransactionContext is used
+// purely to pin that connection for the time between Lock and
+// Unlock -- the advisory lock itself outlives the transaction's
+// eventual commit.
+type pgLocker struct {
+	c   *Connection
+	key int64
+	tx  *Connection
+}
+
+func newPGLocker(c *Connection) Locker {
+	return &pgLocker{c: c, key: lockKey(c.MigrationTableName())}
+}
+
+func (l *pgLocker) Lock(ctx context.Context) error {
+	tx, err := l.c.NewTransactionContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "problem starting postgres advisory lock session")
+	}
+	if _, err := tx.Store.ExecContext(ctx, "select pg_advisory_lock($1)", l.key); err != nil {
+		tx.TX.Rollback()
+		return errors.Wrap(err, "problem acquiring postgres advisory lock")
+	}
+	l.tx = tx
+	return nil
+}
+
+func (l *pgLocker) Unlock(ctx context.Context) error {
+	if l.tx == nil {
+		return nil
+	}
+	tx := l.tx
+	l.tx = nil
+
+	var released bool
+	if err := tx.Store.QueryRowxContext(ctx, "select pg_advisory_unlock($1)", l.key).Scan(&released); err != nil {
+		tx.TX.Rollback()
+		return errors.Wrap(err, "problem releasing postgres advisory lock")
+	}
+	if err := tx.TX.Commit(); err != nil {
+		return errors.Wrap(err, "problem closing postgres advisory lock session")
+	}
+	if !released {
+		return errors.Errorf("postgres advisory lock %d was not held on this connection", l.key)
+	}
+	return nil
+}
+
+// mysqlLocker uses MySQL's named lock functions. The lock name is
+// derived from the migration table name so unrelated applications
+// sharing a database don't collide. GET_LOCK/RELEASE_LOCK are scoped
+// to the session that acquired them, so -- as with pgLocker -- Lock
+// and Unlock are pinned onto the same connection via a transaction
+// opened for the sole purpose of holding that connection open.
+type mysqlLocker struct {
+	c       *Connection
+	name    string
+	timeout time.Duration
+	tx      *Connection
+}
+
+func newMySQLLocker(c *Connection, timeout time.Duration) Locker {
+	return &mysqlLocker{c: c, name: c.MigrationTableName(), timeout: timeout}
+}
+
+func (l *mysqlLocker) Lock(ctx context.Context) error {
+	timeoutSeconds := int(l.timeout.Seconds())
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = -1 // MySQL treats a negative timeout as "wait forever"
+	}
+
+	tx, err := l.c.NewTransactionContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "problem starting mysql lock session")
+	}
+
+	var res int
+	if err := tx.Store.QueryRowxContext(ctx, "select GET_LOCK(?, ?)", l.name, timeoutSeconds).Scan(&res); err != nil {
+		tx.TX.Rollback()
+		return errors.Wrap(err, "problem acquiring mysql lock")
+	}
+	if res != 1 {
+		tx.TX.Rollback()
+		return errors.Errorf("timed out waiting for mysql lock %q", l.name)
+	}
+	l.tx = tx
+	return nil
+}
+
+func (l *mysqlLocker) Unlock(ctx context.Context) error {
+	if l.tx == nil {
+		return nil
+	}
+	tx := l.tx
+	l.tx = nil
+
+	var released sql.NullInt64
+	if err := tx.Store.QueryRowxContext(ctx, "select RELEASE_LOCK(?)", l.name).Scan(&released); err != nil {
+		tx.TX.Rollback()
+		return errors.Wrap(err, "problem releasing mysql lock")
+	}
+	if err := tx.TX.Commit(); err != nil {
+		return errors.Wrap(err, "problem closing mysql lock session")
+	}
+	if !released.Valid || released.Int64 != 1 {
+		return errors.Errorf("mysql lock %q was not held on this connection", l.name)
+	}
+	return nil
+}
+
+// sqliteLocker serializes migrations by holding a write transaction
+// open against the database for the duration of the run. SQLite has
+// no session-scoped advisory lock primitive, and a literal BEGIN
+// EXCLUSIVE can't be layered on top of the transaction
+// NewTransactionContext already opened (SQLite rejects a BEGIN inside
+// an open transaction). Instead, a real write statement is executed
+// as soon as the transaction starts, which forces SQLite to escalate
+// it to a RESERVED lock -- blocking any other writer, including
+// another process's migration run -- until this transaction commits
+// or rolls back.
+type sqliteLocker struct {
+	c  *Connection
+	tx *Connection
+}
+
+func newSQLiteLocker(c *Connection) Locker {
+	return &sqliteLocker{c: c}
+}
+
+func (l *sqliteLocker) Lock(ctx context.Context) error {
+	tx, err := l.c.NewTransactionContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "problem starting sqlite lock transaction")
+	}
+	mtn := l.c.MigrationTableName()
+	if _, err := tx.Store.ExecContext(ctx, fmt.Sprintf("update %s set version = version", mtn)); err != nil {
+		tx.TX.Rollback()
+		return errors.Wrap(err, "problem acquiring sqlite migration lock")
+	}
+	l.tx = tx
+	return nil
+}
+
+func (l *sqliteLocker) Unlock(ctx context.Context) error {
+	if l.tx == nil {
+		return nil
+	}
+	tx := l.tx
+	l.tx = nil
+
+	return errors.Wrap(tx.TX.Commit(), "problem releasing sqlite migration lock")
+}
+
+// lockerForDialect returns the appropriate Locker for the connection's
+// dialect, falling back to NoLock for dialects without a known
+// advisory lock mechanism.
+func lockerForDialect(c *Connection, timeout time.Duration) Locker {
+	switch c.Dialect.Name() {
+	case "postgres":
+		return newPGLocker(c)
+	case "mysql":
+		return newMySQLLocker(c, timeout)
+	case "sqlite3":
+		return newSQLiteLocker(c)
+	default:
+		return NoLock
+	}
+}
@@ -0,0 +1,29 @@
+package pop
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_lockKey(t *testing.T) {
+	a := lockKey("schema_migrations")
+	b := lockKey("schema_migrations")
+	if a != b {
+		t.Fatalf("lockKey(%q) is not stable: got %d and %d", "schema_migrations", a, b)
+	}
+
+	c := lockKey("other_migrations")
+	if a == c {
+		t.Fatalf("lockKey returned the same key for different table names: %d", a)
+	}
+}
+
+func Test_NoLock(t *testing.T) {
+	ctx := context.Background()
+	if err := NoLock.Lock(ctx); err != nil {
+		t.Fatalf("NoLock.Lock returned an error: %v", err)
+	}
+	if err := NoLock.Unlock(ctx); err != nil {
+		t.Fatalf("NoLock.Unlock returned an error: %v", err)
+	}
+}
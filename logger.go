@@ -0,0 +1,75 @@
+package pop
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Logger is implemented by anything Migrator can emit its progress
+// messages to. It lets the library be embedded in servers that emit
+// structured (e.g. JSON) logs to stderr, instead of writing directly
+// to stdout.
+type Logger interface {
+	Infof(string, ...interface{})
+	Errorf(string, ...interface{})
+	Debugf(string, ...interface{})
+}
+
+// defaultLogger is the Logger used by a Migrator that hasn't had one
+// set explicitly. It preserves the library's historical behavior of
+// printing migration progress to stdout.
+type defaultLogger struct {
+	*log.Logger
+}
+
+func newDefaultLogger() *defaultLogger {
+	return &defaultLogger{Logger: log.New(logWriter{}, "", 0)}
+}
+
+func (l *defaultLogger) Infof(format string, args ...interface{})  { l.Printf(format, args...) }
+func (l *defaultLogger) Errorf(format string, args ...interface{}) { l.Printf(format, args...) }
+func (l *defaultLogger) Debugf(format string, args ...interface{}) {}
+
+// logWriter routes the default logger's output through fmt.Print so
+// existing callers relying on the exact "> migration_name" / timer
+// output on stdout see no behavior change.
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	return fmt.Print(string(p))
+}
+
+// MigrationHooks are optional callbacks invoked around each migration
+// run, useful for metrics (Prometheus histograms per migration) or
+// tracing (OpenTelemetry spans) without forking the library.
+type MigrationHooks struct {
+	// OnStart is called immediately before a migration's SQL is
+	// executed, once per migration attempt.
+	OnStart func(seq int32, name, direction, sql string)
+	// OnBeforeMigration is called before a migration runs, before its
+	// transaction is opened.
+	OnBeforeMigration func(dir string, mi Migration)
+	// OnAfterMigration is called after a migration's transaction has
+	// committed or rolled back, with the error (if any) and how long
+	// the run took.
+	OnAfterMigration func(dir string, mi Migration, duration time.Duration, err error)
+}
+
+func (h MigrationHooks) beforeMigration(dir string, mi Migration) {
+	if h.OnBeforeMigration != nil {
+		h.OnBeforeMigration(dir, mi)
+	}
+}
+
+func (h MigrationHooks) afterMigration(dir string, mi Migration, duration time.Duration, err error) {
+	if h.OnAfterMigration != nil {
+		h.OnAfterMigration(dir, mi, duration, err)
+	}
+}
+
+func (h MigrationHooks) onStart(seq int32, name, direction, sql string) {
+	if h.OnStart != nil {
+		h.OnStart(seq, name, direction, sql)
+	}
+}
@@ -0,0 +1,279 @@
+package pop
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationSource knows how to discover the set of migrations
+// available for a given dialect. Migrator.Migrations is populated by
+// calling FindMigrations once at construction time and splitting the
+// result by direction, so that where those migrations actually live (disk, an embedded
+// filesystem, an in-memory list for tests, or a bundler's generated
+// assets) is an implementation detail of the source.
+type MigrationSource interface {
+	FindMigrations(dialect string) (Migrations, error)
+}
+
+// FileMigrationSource finds migrations in a directory on disk. This
+// is the original, and still default, behavior of Migrator.
+type FileMigrationSource struct {
+	Dir string
+}
+
+// FindMigrations implements MigrationSource by walking Dir for files
+// matching the standard `<version>_<name>.<direction>.(sql|fizz)`
+// pattern.
+func (f FileMigrationSource) FindMigrations(dialect string) (Migrations, error) {
+	return migrationsFromFS(os.DirFS(f.Dir), ".", dialect)
+}
+
+// EmbedFileSystemMigrationSource finds migrations inside an fs.FS,
+// typically one produced by go:embed. This lets library users ship
+// their migrations inside the compiled binary rather than needing
+// files on disk at runtime.
+type EmbedFileSystemMigrationSource struct {
+	FS  fs.FS
+	Dir string
+}
+
+// FindMigrations implements MigrationSource.
+func (e EmbedFileSystemMigrationSource) FindMigrations(dialect string) (Migrations, error) {
+	dir := e.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return migrationsFromFS(e.FS, dir, dialect)
+}
+
+// MemoryMigration is a single migration held entirely in memory,
+// used by MemoryMigrationSource.
+type MemoryMigration struct {
+	Version    string
+	Name       string
+	DBType     string
+	Direction  string
+	SQL        string
+	RunnerNoTx func(*Connection) error
+}
+
+// MemoryMigrationSource returns a fixed list of migrations supplied by
+// the caller, with no filesystem involved. It exists primarily for
+// tests that want full control over the migration set.
+type MemoryMigrationSource struct {
+	Migrations []MemoryMigration
+}
+
+// FindMigrations implements MigrationSource.
+func (m MemoryMigrationSource) FindMigrations(dialect string) (Migrations, error) {
+	var out Migrations
+	for _, mm := range m.Migrations {
+		if mm.Direction != "up" && mm.Direction != "down" {
+			return nil, errors.Errorf("memory migration %s has invalid direction %q", mm.Name, mm.Direction)
+		}
+		mm := mm
+		out = append(out, Migration{
+			Path:          "memory://" + mm.Name,
+			Version:       mm.Version,
+			Name:          mm.Name,
+			DBType:        dbTypeOrAll(mm.DBType),
+			Direction:     mm.Direction,
+			Type:          "sql",
+			Checksum:      checksum([]byte(mm.SQL)),
+			NoTransaction: hasNoTransactionDirective([]byte(mm.SQL)),
+			SQL:           mm.SQL,
+			Runner: func(mi Migration, c *Connection) error {
+				if mm.RunnerNoTx != nil {
+					return mm.RunnerNoTx(c)
+				}
+				return genericRun(c, mi, mm.SQL)
+			},
+		})
+	}
+	sort.Sort(out)
+	return out, nil
+}
+
+// AssetMigration describes a single migration produced by an
+// arbitrary asset bundler (go-bindata, statik, packr, etc).
+type AssetMigration struct {
+	Name string
+	Blob []byte
+}
+
+// AssetMigrationSource finds migrations via a bundler-provided
+// AssetNames/Asset pair, for tooling that predates fs.FS.
+type AssetMigrationSource struct {
+	AssetNames func() []string
+	Asset      func(name string) ([]byte, error)
+}
+
+// FindMigrations implements MigrationSource.
+func (a AssetMigrationSource) FindMigrations(dialect string) (Migrations, error) {
+	var out Migrations
+	for _, name := range a.AssetNames() {
+		mf, ok := parseMigrationFilename(name)
+		if !ok {
+			continue
+		}
+		if mf.DBType != "all" && mf.DBType != dialect {
+			continue
+		}
+		b, err := a.Asset(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading migration asset %s", name)
+		}
+		mf.Path = name
+		mf.Checksum = checksum(b)
+		mf.NoTransaction = mf.NoTransaction || hasNoTransactionDirective(b)
+		content := string(b)
+		mf.SQL = content
+		mf.Runner = func(mi Migration, c *Connection) error {
+			return genericRun(c, mi, content)
+		}
+		out = append(out, mf)
+	}
+	sort.Sort(out)
+	return out, nil
+}
+
+// migrationsFromFS is shared by FileMigrationSource and
+// EmbedFileSystemMigrationSource, both of which discover migrations
+// by walking an fs.FS. The migration body is read once, up front, so
+// its checksum is known (for drift detection in Verify) without
+// having to run the migration first.
+func migrationsFromFS(fsys fs.FS, dir, dialect string) (Migrations, error) {
+	var out Migrations
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		mf, ok := parseMigrationFilename(filepath.Base(path))
+		if !ok {
+			return nil
+		}
+		if mf.DBType != "all" && mf.DBType != dialect {
+			return nil
+		}
+		b, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return errors.Wrapf(err, "problem reading migration file %s", path)
+		}
+		mf.Path = path
+		mf.Checksum = checksum(b)
+		mf.NoTransaction = mf.NoTransaction || hasNoTransactionDirective(b)
+		content := string(b)
+		mf.SQL = content
+		mf.Runner = func(mi Migration, c *Connection) error {
+			return genericRun(c, mi, content)
+		}
+		out = append(out, mf)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "problem finding migrations")
+	}
+	sort.Sort(out)
+	return out, nil
+}
+
+// checksum returns the stored migration_hash value for a migration's
+// content, used by Verify to detect a file that has changed since it
+// was applied.
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func dbTypeOrAll(dbType string) string {
+	if dbType == "" {
+		return "all"
+	}
+	return dbType
+}
+
+// genericRun executes a plain SQL migration body against c, used by
+// the built-in MigrationSource implementations.
+func genericRun(c *Connection, mi Migration, content string) error {
+	return c.RawQuery(content).Exec()
+}
+
+// parseMigrationFilename parses a filename matching the standard
+// `<version>_<name>[.<dbtype>].(up|down).(sql|fizz)` pattern into a
+// Migration. It reports false if the filename doesn't match. A
+// `.no_tx.` infix in the name opts a migration out of running inside
+// a transaction (e.g. `20240101_add_index.no_tx.up.sql`) and is not
+// taken as a dialect.
+func parseMigrationFilename(name string) (Migration, bool) {
+	// mrx's infix group only admits [a-z0-9], so the no_tx marker is
+	// taken out of the name before matching.
+	noTx := false
+	match := name
+	if i := strings.LastIndex(name, "."+noTxSuffix+"."); i >= 0 {
+		noTx = true
+		match = name[:i] + name[i+len(noTxSuffix)+1:]
+	}
+	matches := mrx.FindStringSubmatch(match)
+	if len(matches) == 0 {
+		return Migration{}, false
+	}
+	dbType := "all"
+	if matches[3] != "" {
+		dbType = matches[3][1:]
+	}
+	return Migration{
+		Version:       matches[1],
+		Name:          name,
+		DBType:        dbType,
+		Direction:     matches[4],
+		Type:          matches[5],
+		NoTransaction: noTx,
+	}, true
+}
+
+// MigrationSet bundles a MigrationSource together with options
+// controlling how its migrations are applied, mirroring the knobs
+// found in sql-migrate.
+type MigrationSet struct {
+	Source MigrationSource
+
+	// IgnoreUnknown skips versions recorded in the schema table that
+	// have no corresponding migration in Source, instead of erroring.
+	IgnoreUnknown bool
+	// DisableCreateTable skips the automatic creation of the schema
+	// migrations table; the caller is responsible for it existing.
+	DisableCreateTable bool
+	// SchemaName qualifies the schema migrations table name, for
+	// databases that support schemas/namespaces.
+	SchemaName string
+	// Limit caps the number of migrations applied by Up/Down when no
+	// explicit version or step is given. Zero means no limit.
+	Limit int
+	// TargetVersion, if set, migrates up to (or down to) this version
+	// rather than applying all pending migrations.
+	TargetVersion string
+}
+
+// NewMigratorFromSource builds a Migrator whose Migrations are loaded
+// from source for both the "up" and "down" directions.
+func NewMigratorFromSource(c *Connection, source MigrationSource) (Migrator, error) {
+	m := NewMigrator(c)
+	up, err := source.FindMigrations(c.Dialect.Name())
+	if err != nil {
+		return Migrator{}, errors.Wrap(err, "problem finding up migrations")
+	}
+	for _, mi := range up {
+		m.Migrations[mi.Direction] = append(m.Migrations[mi.Direction], mi)
+	}
+	return m, nil
+}
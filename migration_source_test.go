@@ -0,0 +1,112 @@
+package pop
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func Test_MemoryMigrationSource_FindMigrations(t *testing.T) {
+	src := MemoryMigrationSource{
+		Migrations: []MemoryMigration{
+			{Version: "2", Name: "two", Direction: "up", SQL: "create table two (id int);"},
+			{Version: "1", Name: "one", Direction: "up", DBType: "postgres", SQL: "-- +pop NoTransaction\ncreate index concurrently idx_one on one (id);"},
+		},
+	}
+
+	out, err := src.FindMigrations("postgres")
+	if err != nil {
+		t.Fatalf("FindMigrations returned an error: %v", err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(out))
+	}
+	if out[0].Version != "1" || out[1].Version != "2" {
+		t.Fatalf("expected migrations sorted by version, got %+v", out)
+	}
+	if out[0].DBType != "postgres" {
+		t.Fatalf("expected DBType %q, got %q", "postgres", out[0].DBType)
+	}
+	if out[1].DBType != "all" {
+		t.Fatalf("expected an unset DBType to default to %q, got %q", "all", out[1].DBType)
+	}
+	if !out[0].NoTransaction {
+		t.Fatalf("expected the +pop NoTransaction directive in the SQL body to be detected")
+	}
+	if out[1].SQL != "create table two (id int);" {
+		t.Fatalf("expected SQL to carry the migration body, got %q", out[1].SQL)
+	}
+	if out[1].Checksum != checksum([]byte("create table two (id int);")) {
+		t.Fatalf("expected Checksum to be derived from the SQL body")
+	}
+}
+
+func Test_MemoryMigrationSource_FindMigrations_invalidDirection(t *testing.T) {
+	src := MemoryMigrationSource{
+		Migrations: []MemoryMigration{
+			{Version: "1", Name: "one", Direction: "sideways", SQL: "select 1;"},
+		},
+	}
+	if _, err := src.FindMigrations("postgres"); err == nil {
+		t.Fatalf("expected an invalid Direction to return an error")
+	}
+}
+
+func Test_AssetMigrationSource_FindMigrations(t *testing.T) {
+	assets := map[string][]byte{
+		"20240101000000_create_foo.up.sql":       []byte("create table foo (id int);"),
+		"20240102000000_create_bar.mysql.up.sql": []byte("create table bar (id int);"),
+		"not_a_migration.txt":                    []byte("ignore me"),
+	}
+
+	src := AssetMigrationSource{
+		AssetNames: func() []string {
+			names := make([]string, 0, len(assets))
+			for name := range assets {
+				names = append(names, name)
+			}
+			return names
+		},
+		Asset: func(name string) ([]byte, error) {
+			return assets[name], nil
+		},
+	}
+
+	out, err := src.FindMigrations("postgres")
+	if err != nil {
+		t.Fatalf("FindMigrations returned an error: %v", err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("expected the mysql-only migration and non-migration file to be filtered out, got %+v", out)
+	}
+	if out[0].Version != "20240101000000" {
+		t.Fatalf("expected version %q, got %q", "20240101000000", out[0].Version)
+	}
+	if out[0].Path != "20240101000000_create_foo.up.sql" {
+		t.Fatalf("expected Path to be set to the asset name, got %q", out[0].Path)
+	}
+	if out[0].Checksum != checksum(assets["20240101000000_create_foo.up.sql"]) {
+		t.Fatalf("expected Checksum to be derived from the asset body")
+	}
+}
+
+func Test_migrationsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20240101000000_create_foo.up.sql":       &fstest.MapFile{Data: []byte("create table foo (id int);")},
+		"migrations/20240101000000_create_foo.down.sql":     &fstest.MapFile{Data: []byte("drop table foo;")},
+		"migrations/20240102000000_create_bar.mysql.up.sql": &fstest.MapFile{Data: []byte("create table bar (id int);")},
+		"migrations/README.md":                              &fstest.MapFile{Data: []byte("not a migration")},
+	}
+
+	out, err := migrationsFromFS(fsys, "migrations", "postgres")
+	if err != nil {
+		t.Fatalf("migrationsFromFS returned an error: %v", err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("expected the mysql-only migration and README to be filtered out, got %+v", out)
+	}
+	for _, mi := range out {
+		if mi.DBType != "all" {
+			t.Fatalf("expected DBType %q for a postgres-dialect search, got %q", "all", mi.DBType)
+		}
+	}
+}
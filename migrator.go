@@ -1,7 +1,9 @@
 package pop
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -21,10 +23,12 @@ var mrx = regexp.MustCompile(`(\d+)_([^\.]+)(\.[a-z0-9]+)?\.(up|down)\.(sql|fizz
 func NewMigrator(c *Connection) Migrator {
 	return Migrator{
 		Connection: c,
+		SchemaPath: "",
 		Migrations: map[string]Migrations{
 			"up":   Migrations{},
 			"down": Migrations{},
 		},
+		LockTimeout: 10 * time.Second,
 	}
 }
 
@@ -36,66 +40,208 @@ type Migrator struct {
 	Connection *Connection
 	SchemaPath string
 	Migrations map[string]Migrations
+
+	// Locker serializes migration runs across processes sharing this
+	// database. It defaults to a dialect-appropriate advisory lock the
+	// first time it's needed; set it to NoLock to disable locking.
+	Locker Locker
+	// LockTimeout bounds how long Lock will wait to acquire the lock
+	// before giving up, for dialects (like MySQL) that support it.
+	LockTimeout time.Duration
+
+	// IgnoreUnknown, when true, skips versions recorded in the schema
+	// migrations table that have no corresponding entry in
+	// Migrations["up"], instead of erroring.
+	IgnoreUnknown bool
+	// DisableCreateTable skips the automatic creation of the schema
+	// migrations table; the caller is responsible for it existing.
+	DisableCreateTable bool
+	// SchemaName, if set, qualifies the schema migrations table name
+	// for databases that support schemas/namespaces.
+	SchemaName string
+	// Limit caps the number of migrations Up/Down will apply when no
+	// explicit version/step is given. Zero means no limit.
+	Limit int
+	// TargetVersion, if set, makes Up stop once this version has been
+	// applied, and Down stop before reverting it (leaving it and every
+	// lower version applied), instead of exhausting every migration.
+	TargetVersion string
+	// AllowOutOfOrder permits a pending migration whose version is
+	// lower than the highest applied version, instead of Verify
+	// treating it as drift. This is common when feature branches merge
+	// in an unexpected order.
+	AllowOutOfOrder bool
+
+	// PerMigrationTimeout, if non-zero, bounds how long a single
+	// migration's transaction is allowed to run before its context is
+	// canceled. This keeps one runaway migration from blocking an
+	// entire deploy indefinitely.
+	PerMigrationTimeout time.Duration
+
+	// Logger receives Migrator's progress messages. It defaults to a
+	// logger that reproduces the historical "> name" / timer output on
+	// stdout; set it to route migration progress into structured logs.
+	Logger Logger
+	// Hooks are optional callbacks invoked around each migration run.
+	Hooks MigrationHooks
+	// Options holds cross-cutting Migrator behavior, such as disabling
+	// transactions for every migration.
+	Options MigratorOptions
+}
+
+// logger lazily resolves the Migrator's Logger, defaulting to a
+// logger that preserves the historical stdout output.
+func (m *Migrator) logger() Logger {
+	if m.Logger == nil {
+		m.Logger = newDefaultLogger()
+	}
+	return m.Logger
+}
+
+// NewMigratorFromSet builds a Migrator whose Migrations are loaded
+// from set.Source, with set's options applied to the returned
+// Migrator.
+func NewMigratorFromSet(c *Connection, set MigrationSet) (Migrator, error) {
+	m, err := NewMigratorFromSource(c, set.Source)
+	if err != nil {
+		return Migrator{}, err
+	}
+	m.IgnoreUnknown = set.IgnoreUnknown
+	m.DisableCreateTable = set.DisableCreateTable
+	m.SchemaName = set.SchemaName
+	m.Limit = set.Limit
+	m.TargetVersion = set.TargetVersion
+	return m, nil
+}
+
+// locker lazily resolves the Migrator's Locker, defaulting to a
+// dialect-appropriate advisory lock.
+func (m *Migrator) locker() Locker {
+	if m.Locker == nil {
+		m.Locker = lockerForDialect(m.Connection, m.LockTimeout)
+	}
+	return m.Locker
+}
+
+// migrationTableName returns the name of the schema migrations table,
+// qualified by SchemaName when one is set.
+func (m Migrator) migrationTableName() string {
+	mtn := m.Connection.MigrationTableName()
+	if m.SchemaName == "" {
+		return mtn
+	}
+	return fmt.Sprintf("%s.%s", m.SchemaName, mtn)
+}
+
+// HasPending returns true if there are any "up" migrations that have
+// not yet been applied. It runs under the Migrator's lock so callers
+// can gate application startup on migration state without racing a
+// concurrent migration run.
+func (m Migrator) HasPending() (bool, error) {
+	c := m.Connection
+	ctx := context.Background()
+	l := m.locker()
+	if err := l.Lock(ctx); err != nil {
+		return false, errors.Wrap(err, "problem acquiring migration lock")
+	}
+	defer l.Unlock(ctx)
+
+	if err := m.CreateSchemaMigrations(); err != nil {
+		return false, errors.Wrap(err, "problem creating schema migrations")
+	}
+
+	mtn := m.migrationTableName()
+	for _, mi := range m.Migrations["up"] {
+		if mi.DBType != "all" && mi.DBType != c.Dialect.Name() {
+			continue
+		}
+		exists, err := c.Where("version = ?", mi.Version).Exists(mtn)
+		if err != nil {
+			return false, errors.Wrapf(err, "problem checking for migration version %s", mi.Version)
+		}
+		if !exists {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // Up runs pending "up" migrations and applies them to the database.
 // If a version is provided, only this version will be applied.
 func (m Migrator) Up(version ...string) error {
+	return m.UpContext(context.Background(), version...)
+}
+
+// UpContext is Up, with ctx threaded through the transaction and
+// connection calls so a caller can cancel an in-flight migration run
+// (e.g. on service shutdown).
+func (m Migrator) UpContext(ctx context.Context, version ...string) error {
 	c := m.Connection
 	if len(version) > 1 {
 		return errors.New("you can't pick more than one version to apply")
 	}
-	return m.exec(func() error {
-		mtn := c.MigrationTableName()
+	return m.exec(ctx, func(ctx context.Context) error {
+		mtn := m.migrationTableName()
 		mfs := m.Migrations["up"]
 		sort.Sort(mfs)
 
-		m := func(mi Migration, c *Connection) error {
+		// run applies mi if it's pending for this dialect, reporting
+		// whether it actually ran so callers can count applied
+		// migrations against Limit.
+		run := func(ctx context.Context, seq int32, mi Migration, c *Connection) (bool, error) {
 			if mi.DBType != "all" && mi.DBType != c.Dialect.Name() {
 				// Skip migration for non-matching dialect
-				return nil
+				return false, nil
 			}
 			exists, err := c.Where("version = ?", mi.Version).Exists(mtn)
 			if err != nil {
-				return errors.Wrapf(err, "problem checking for migration version %s", mi.Version)
+				return false, errors.Wrapf(err, "problem checking for migration version %s", mi.Version)
 			}
 			if exists {
-				return nil
+				return false, nil
 			}
-			err = c.Transaction(func(tx *Connection) error {
-				err := mi.Run(tx)
-				if err != nil {
-					return err
-				}
-				_, err = tx.Store.Exec(fmt.Sprintf("insert into %s (version) values ('%s')", mtn, mi.Version))
-				return errors.Wrapf(err, "problem inserting migration version %s", mi.Version)
-			})
-			if err != nil {
-				return errors.WithStack(err)
+			if err := m.runMigration(ctx, seq, mi, "up", insertVersion(mtn, mi)); err != nil {
+				return false, err
 			}
-			fmt.Printf("> %s\n", mi.Name)
-			return nil
+			m.logger().Infof("> %s", mi.Name)
+			return true, nil
 		}
 
 		if len(version) > 0 {
 			v := version[0]
 			// Apply the picked migration, if it exists
 			var vrx = regexp.MustCompile(regexp.QuoteMeta(v) + `\.(up|down)\.(sql|fizz)$`)
-			for _, mi := range mfs {
+			for i, mi := range mfs {
 				if vrx.Match([]byte(mi.Name)) {
-					if err := m(mi, c); err != nil {
-						return err
-					}
-					return nil
+					_, err := run(ctx, int32(i), mi, c)
+					return err
 				}
 			}
 			return fmt.Errorf("migration \"%s\" not found", v)
 		}
-		// Apply all remaining migrations
-		for _, mi := range mfs {
-			if err := m(mi, c); err != nil {
+		// Apply all remaining migrations, honoring Limit and
+		// TargetVersion when set.
+		applied := 0
+		for i, mi := range mfs {
+			if m.TargetVersion != "" && mi.Version > m.TargetVersion {
+				break
+			}
+			ran, err := run(ctx, int32(i), mi, c)
+			if err != nil {
 				return err
 			}
+			if ran {
+				applied++
+			}
+			if ctx.Err() != nil {
+				return errors.Wrap(ctx.Err(), "migration up: context canceled")
+			}
+			if m.Limit > 0 && applied >= m.Limit {
+				break
+			}
+			if m.TargetVersion != "" && mi.Version == m.TargetVersion {
+				break
+			}
 		}
 		return nil
 	})
@@ -104,9 +250,15 @@ func (m Migrator) Up(version ...string) error {
 // Down runs pending "down" migrations and rolls back the
 // database by the specified number of steps.
 func (m Migrator) Down(step int) error {
+	return m.DownContext(context.Background(), step)
+}
+
+// DownContext is Down, with ctx threaded through the transaction and
+// connection calls so a caller can cancel an in-flight rollback.
+func (m Migrator) DownContext(ctx context.Context, step int) error {
 	c := m.Connection
-	return m.exec(func() error {
-		mtn := c.MigrationTableName()
+	return m.exec(ctx, func(ctx context.Context) error {
+		mtn := m.migrationTableName()
 		count, err := c.Count(mtn)
 		if err != nil {
 			return errors.Wrap(err, "migration down: unable count existing migration")
@@ -117,28 +269,32 @@ func (m Migrator) Down(step int) error {
 		if len(mfs) > count {
 			mfs = mfs[len(mfs)-count:]
 		}
-		// run only required steps
+		// run only required steps; Limit is the fallback step count
+		// when the caller didn't ask for a specific number
 		if step > 0 && len(mfs) >= step {
 			mfs = mfs[:step]
+		} else if step <= 0 && m.Limit > 0 && len(mfs) >= m.Limit {
+			mfs = mfs[:m.Limit]
 		}
-		for _, mi := range mfs {
+		for i, mi := range mfs {
+			// TargetVersion stops reverting once it's reached, leaving
+			// that version (and anything below it) applied
+			if m.TargetVersion != "" && mi.Version <= m.TargetVersion {
+				break
+			}
 			exists, err := c.Where("version = ?", mi.Version).Exists(mtn)
 			if err != nil || !exists {
 				return errors.Wrapf(err, "problem checking for migration version %s", mi.Version)
 			}
-			err = c.Transaction(func(tx *Connection) error {
-				err := mi.Run(tx)
-				if err != nil {
-					return err
-				}
-				err = tx.RawQuery(fmt.Sprintf("delete from %s where version = ?", mtn), mi.Version).Exec()
-				return errors.Wrapf(err, "problem deleting migration version %s", mi.Version)
-			})
-			if err != nil {
+			if err := m.runMigration(ctx, int32(i), mi, "down", deleteVersion(mtn, mi)); err != nil {
 				return err
 			}
 
-			fmt.Printf("< %s\n", mi.Name)
+			m.logger().Infof("< %s", mi.Name)
+
+			if ctx.Err() != nil {
+				return errors.Wrap(ctx.Err(), "migration down: context canceled")
+			}
 		}
 		return nil
 	})
@@ -146,28 +302,52 @@ func (m Migrator) Down(step int) error {
 
 // Reset the database by running the down migrations followed by the up migrations.
 func (m Migrator) Reset() error {
-	err := m.Down(-1)
+	return m.ResetContext(context.Background())
+}
+
+// ResetContext is Reset, with ctx threaded through the down and up
+// runs it performs.
+func (m Migrator) ResetContext(ctx context.Context) error {
+	err := m.DownContext(ctx, -1)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	return m.Up()
+	return m.UpContext(ctx)
+}
+
+// withPerMigrationTimeout wraps ctx with PerMigrationTimeout, if set.
+// The returned cancel func must always be called.
+func (m Migrator) withPerMigrationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.PerMigrationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, m.PerMigrationTimeout)
 }
 
 // CreateSchemaMigrations sets up a table to track migrations. This is an idempotent
 // operation.
 func (m Migrator) CreateSchemaMigrations() error {
+	return m.CreateSchemaMigrationsContext(context.Background())
+}
+
+// CreateSchemaMigrationsContext is CreateSchemaMigrations, with ctx
+// threaded through the connection calls it makes.
+func (m Migrator) CreateSchemaMigrationsContext(ctx context.Context) error {
+	if m.DisableCreateTable {
+		return nil
+	}
 	c := m.Connection
-	mtn := c.MigrationTableName()
+	mtn := m.migrationTableName()
 	err := c.Open()
 	if err != nil {
 		return errors.Wrap(err, "could not open connection")
 	}
-	_, err = c.Store.Exec(fmt.Sprintf("select * from %s", mtn))
+	_, err = c.Store.ExecContext(ctx, fmt.Sprintf("select * from %s", mtn))
 	if err == nil {
-		return nil
+		return m.ensureMigrationHashColumnContext(ctx)
 	}
 
-	return c.Transaction(func(tx *Connection) error {
+	return transactionContext(c, ctx, func(tx *Connection) error {
 		schemaMigrations := newSchemaMigrations(mtn)
 		smSQL, err := c.Dialect.FizzTranslator().CreateTable(schemaMigrations)
 		if err != nil {
@@ -183,14 +363,20 @@ func (m Migrator) CreateSchemaMigrations() error {
 
 // Status prints out the status of applied/pending migrations.
 func (m Migrator) Status() error {
-	err := m.CreateSchemaMigrations()
+	return m.StatusContext(context.Background(), os.Stdout)
+}
+
+// StatusContext is Status, writing to w instead of os.Stdout and
+// threading ctx through the connection calls it makes.
+func (m Migrator) StatusContext(ctx context.Context, w io.Writer) error {
+	err := m.CreateSchemaMigrationsContext(ctx)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.TabIndent)
-	fmt.Fprintln(w, "Version\tName\tStatus\t")
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(tw, "Version\tName\tStatus\t")
 	for _, mf := range m.Migrations["up"] {
-		exists, err := m.Connection.Where("version = ?", mf.Version).Exists(m.Connection.MigrationTableName())
+		exists, err := m.Connection.Where("version = ?", mf.Version).Exists(m.migrationTableName())
 		if err != nil {
 			return errors.Wrapf(err, "problem with migration")
 		}
@@ -198,9 +384,23 @@ func (m Migrator) Status() error {
 		if exists {
 			state = "Applied"
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t\n", mf.Version, mf.Name, state)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", mf.Version, mf.Name, state)
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	drifts, err := m.detectDriftContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "problem checking for migration drift")
+	}
+	if len(drifts) > 0 {
+		fmt.Fprintln(w, "\nDrift detected:")
+		for _, d := range drifts {
+			fmt.Fprintf(w, "  %s\n", d.String())
+		}
 	}
-	return w.Flush()
+	return nil
 }
 
 // DumpMigrationSchema will generate a file of the current database schema
@@ -222,23 +422,29 @@ func (m Migrator) DumpMigrationSchema() error {
 	return nil
 }
 
-func (m Migrator) exec(fn func() error) error {
+func (m Migrator) exec(ctx context.Context, fn func(ctx context.Context) error) error {
 	now := time.Now()
 	defer m.DumpMigrationSchema()
-	defer printTimer(now)
+	defer m.printTimer(now)
+
+	l := m.locker()
+	if err := l.Lock(ctx); err != nil {
+		return errors.Wrap(err, "Migrator: problem acquiring migration lock")
+	}
+	defer l.Unlock(ctx)
 
-	err := m.CreateSchemaMigrations()
+	err := m.CreateSchemaMigrationsContext(ctx)
 	if err != nil {
 		return errors.Wrap(err, "Migrator: problem creating schema migrations")
 	}
-	return fn()
+	return fn(ctx)
 }
 
-func printTimer(timerStart time.Time) {
+func (m Migrator) printTimer(timerStart time.Time) {
 	diff := time.Since(timerStart).Seconds()
 	if diff > 60 {
-		fmt.Printf("\n%.4f minutes\n", diff/60)
+		m.logger().Infof("\n%.4f minutes\n", diff/60)
 	} else {
-		fmt.Printf("\n%.4f seconds\n", diff)
+		m.logger().Infof("\n%.4f seconds\n", diff)
 	}
 }
@@ -0,0 +1,131 @@
+package pop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// noTxDirective is a comment a migration file can put in its header to
+// opt out of running inside a transaction, for statements that can't
+// run in one (CREATE INDEX CONCURRENTLY, ALTER TYPE ... ADD VALUE,
+// MySQL DDL that implicitly commits, etc). Pop also recognizes a
+// `.no_tx.` filename suffix for the same purpose.
+const noTxDirective = "+pop NoTransaction"
+
+// noTxSuffix is the filename infix that opts a migration out of
+// running inside a transaction, e.g. `20240101_add_index.no_tx.up.sql`.
+const noTxSuffix = "no_tx"
+
+// hasNoTransactionDirective reports whether content's header carries
+// the `-- +pop NoTransaction` directive.
+func hasNoTransactionDirective(content []byte) bool {
+	for _, line := range bytes.SplitN(content, []byte("\n"), 20) {
+		l := strings.TrimSpace(string(line))
+		if l == "" {
+			continue
+		}
+		if !strings.HasPrefix(l, "--") && !strings.HasPrefix(l, "#") {
+			break
+		}
+		if strings.Contains(l, noTxDirective) {
+			return true
+		}
+	}
+	return false
+}
+
+// MigratorOptions configures optional, cross-cutting behavior of a
+// Migrator that doesn't belong on individual migrations.
+type MigratorOptions struct {
+	// DisableTx, when true, runs every migration directly against the
+	// connection instead of inside a transaction, regardless of
+	// whether the migration file opted out individually. The version
+	// row is still recorded in its own short transaction after the
+	// migration succeeds.
+	DisableTx bool
+}
+
+// noTx reports whether mi should run outside of a transaction, either
+// because it opted out itself or because the Migrator was configured
+// to disable transactions globally.
+func (m Migrator) noTx(mi Migration) bool {
+	return m.Options.DisableTx || mi.NoTransaction
+}
+
+// runMigration executes mi and then record (the version table insert
+// or delete) as a unit, honoring the migration's transaction
+// preference. When mi runs inside a transaction, record runs in the
+// same transaction as mi, so the version row only ever exists if the
+// migration succeeded. When mi opts out of a transaction, mi is run
+// directly against m.Connection, and record runs afterwards in its
+// own short transaction -- so the version row is still only written
+// if the DDL itself succeeded, even though the two aren't atomic with
+// each other.
+func (m Migrator) runMigration(ctx context.Context, seq int32, mi Migration, direction string, record func(ctx context.Context, tx *Connection) error) error {
+	c := m.Connection
+	ctx, cancel := m.withPerMigrationTimeout(ctx)
+	defer cancel()
+
+	m.Hooks.beforeMigration(direction, mi)
+	start := time.Now()
+
+	var err error
+	if m.noTx(mi) {
+		m.Hooks.onStart(seq, mi.Name, direction, mi.SQL)
+		if err = runNoTx(ctx, c, mi); err == nil {
+			err = transactionContext(c, ctx, func(tx *Connection) error {
+				return record(ctx, tx)
+			})
+		}
+	} else {
+		err = transactionContext(c, ctx, func(tx *Connection) error {
+			m.Hooks.onStart(seq, mi.Name, direction, mi.SQL)
+			if rErr := mi.Run(tx); rErr != nil {
+				return rErr
+			}
+			return record(ctx, tx)
+		})
+	}
+
+	m.Hooks.afterMigration(direction, mi, time.Since(start), err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// runNoTx executes mi directly against c for the no-tx path. mi.Run
+// has no context parameter, so running it directly would leave
+// PerMigrationTimeout with no effect on the one statement it exists to
+// bound -- the long-running DDL a no-tx migration holds (CREATE INDEX
+// CONCURRENTLY and friends). When mi's SQL body is known, it's run via
+// Store.ExecContext instead so ctx is actually honored; this covers
+// every built-in MigrationSource. A migration with no SQL text (e.g. a
+// MemoryMigration using a custom RunnerNoTx) has no context-aware path
+// available and falls back to mi.Run.
+func runNoTx(ctx context.Context, c *Connection, mi Migration) error {
+	if mi.SQL == "" {
+		return mi.Run(c)
+	}
+	_, err := c.Store.ExecContext(ctx, mi.SQL)
+	return err
+}
+
+func insertVersion(mtn string, mi Migration) func(ctx context.Context, tx *Connection) error {
+	return func(ctx context.Context, tx *Connection) error {
+		_, err := tx.Store.ExecContext(ctx, fmt.Sprintf("insert into %s (version, migration_hash) values ('%s', '%s')", mtn, mi.Version, mi.Checksum))
+		return errors.Wrapf(err, "problem inserting migration version %s", mi.Version)
+	}
+}
+
+func deleteVersion(mtn string, mi Migration) func(ctx context.Context, tx *Connection) error {
+	return func(ctx context.Context, tx *Connection) error {
+		err := tx.RawQuery(fmt.Sprintf("delete from %s where version = ?", mtn), mi.Version).Exec()
+		return errors.Wrapf(err, "problem deleting migration version %s", mi.Version)
+	}
+}
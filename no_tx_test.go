@@ -0,0 +1,90 @@
+package pop
+
+import "testing"
+
+func Test_hasNoTransactionDirective(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{
+			name:    "dash comment directive",
+			content: "-- +pop NoTransaction\nCREATE INDEX CONCURRENTLY foo ON bar (baz);\n",
+			want:    true,
+		},
+		{
+			name:    "hash comment directive",
+			content: "# +pop NoTransaction\nALTER TYPE status ADD VALUE 'archived';\n",
+			want:    true,
+		},
+		{
+			name:    "directive after other header comments",
+			content: "-- migrates the foo table\n-- +pop NoTransaction\nCREATE INDEX CONCURRENTLY foo ON bar (baz);\n",
+			want:    true,
+		},
+		{
+			name:    "no directive",
+			content: "-- migrates the foo table\nCREATE TABLE foo (id serial primary key);\n",
+			want:    false,
+		},
+		{
+			name:    "directive appears only after the comment header ends",
+			content: "CREATE TABLE foo (id serial primary key);\n-- +pop NoTransaction\n",
+			want:    false,
+		},
+		{
+			name:    "empty content",
+			content: "",
+			want:    false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := hasNoTransactionDirective([]byte(c.content))
+			if got != c.want {
+				t.Fatalf("hasNoTransactionDirective(%q) = %v, want %v", c.content, got, c.want)
+			}
+		})
+	}
+}
+
+func Test_parseMigrationFilename_noTxSuffix(t *testing.T) {
+	mi, ok := parseMigrationFilename("20240101000000_add_index.no_tx.up.sql")
+	if !ok {
+		t.Fatalf("expected filename to parse")
+	}
+	if !mi.NoTransaction {
+		t.Fatalf("expected the no_tx suffix to set NoTransaction")
+	}
+	if mi.DBType != "all" {
+		t.Fatalf("expected no_tx suffix not to be treated as a dialect infix, got DBType %q", mi.DBType)
+	}
+}
+
+func Test_parseMigrationFilename_dbTypeInfix(t *testing.T) {
+	mi, ok := parseMigrationFilename("20240101000000_add_index.postgres.up.sql")
+	if !ok {
+		t.Fatalf("expected filename to parse")
+	}
+	if mi.NoTransaction {
+		t.Fatalf("did not expect a dialect infix to set NoTransaction")
+	}
+	if mi.DBType != "postgres" {
+		t.Fatalf("expected DBType %q, got %q", "postgres", mi.DBType)
+	}
+}
+
+func Test_parseMigrationFilename_noInfix(t *testing.T) {
+	mi, ok := parseMigrationFilename("20240101000000_add_index.up.sql")
+	if !ok {
+		t.Fatalf("expected filename to parse")
+	}
+	if mi.NoTransaction {
+		t.Fatalf("did not expect NoTransaction without a no_tx suffix")
+	}
+	if mi.DBType != "all" {
+		t.Fatalf("expected DBType %q, got %q", "all", mi.DBType)
+	}
+}
@@ -0,0 +1,52 @@
+package pop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gobuffalo/fizz"
+	"github.com/pkg/errors"
+)
+
+// newSchemaMigrations builds the table definition for the schema
+// migrations table used to track applied versions. migration_hash
+// stores the checksum of a migration's body at the time it was
+// applied (written by insertVersion), which Verify later compares
+// against the file's current checksum to detect a migration that
+// changed after it ran. version carries a unique index, since the
+// same migration must never be recorded as applied twice.
+func newSchemaMigrations(name string) fizz.Table {
+	t := fizz.NewTable(name, map[string]interface{}{"id": false})
+	t.Column("version", "string", map[string]interface{}{"size": 14})
+	t.Column("migration_hash", "string", map[string]interface{}{"size": 64, "null": true})
+	t.Indexes = append(t.Indexes, fizz.Index{
+		Name:    fmt.Sprintf("%s_version_idx", name),
+		Columns: []string{"version"},
+		Unique:  true,
+	})
+	t.DisableTimestamps()
+	return t
+}
+
+// ensureMigrationHashColumnContext backfills the migration_hash column
+// onto a schema migrations table that was created before checksum
+// based drift detection existed. newSchemaMigrations already includes
+// the column for fresh installs; this covers the table CreateSchemaMigrations
+// found already present.
+func (m Migrator) ensureMigrationHashColumnContext(ctx context.Context) error {
+	c := m.Connection
+	mtn := m.migrationTableName()
+
+	_, err := c.Store.ExecContext(ctx, fmt.Sprintf("select migration_hash from %s", mtn))
+	if err == nil {
+		return nil
+	}
+
+	return transactionContext(c, ctx, func(tx *Connection) error {
+		alterSQL := fmt.Sprintf("alter table %s add column migration_hash varchar(64)", mtn)
+		if err := tx.RawQuery(alterSQL).Exec(); err != nil {
+			return errors.Wrap(err, "problem adding migration_hash column to schema migrations table")
+		}
+		return nil
+	})
+}
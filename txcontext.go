@@ -0,0 +1,24 @@
+package pop
+
+import "context"
+
+// transactionContext runs fn inside a transaction opened via
+// Connection.NewTransactionContext, committing on success and rolling
+// back if fn returns an error. It exists so call sites that want the
+// "open a transaction, run a callback, commit/rollback" shape don't
+// have to repeat that bookkeeping by hand; NewTransactionContext
+// itself only opens the transaction and hands back the *Connection
+// bound to it.
+func transactionContext(c *Connection, ctx context.Context, fn func(tx *Connection) error) error {
+	tx, err := c.NewTransactionContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rbErr := tx.TX.Rollback(); rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	return tx.TX.Commit()
+}